@@ -0,0 +1,193 @@
+// Package cache implements a content-addressed store for downloaded addon
+// zips, so wpm doesn't re-scrape CurseForge/WoWAce/etc. for a file it
+// already has on disk.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Entry is one addon's recorded place in the cache.
+type Entry struct {
+	Name      string
+	Type      string
+	Version   string
+	SHA256    string
+	Size      int64
+	FetchedAt time.Time
+	URL       string
+}
+
+// Index is the on-disk cache.json alongside the sha256-named zips it
+// describes, loaded into memory for the lifetime of a command. upgrade
+// downloads addons in parallel, so every access to entries is guarded by mu.
+type Index struct {
+	mu      sync.Mutex
+	dir     string
+	entries map[string]Entry // keyed by URL
+}
+
+// Dir returns the default cache directory under APPDATA.
+func Dir() string {
+	return filepath.Join(os.Getenv("APPDATA"), "wpm", "cache")
+}
+
+// Open loads (or creates) the cache index rooted at dir.
+func Open(dir string) (*Index, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create cache dir: %v", err)
+	}
+	idx := &Index{dir: dir, entries: make(map[string]Entry)}
+
+	data, err := ioutil.ReadFile(idx.indexPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return idx, nil
+		}
+		return nil, fmt.Errorf("unable to read cache index: %v", err)
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("cache index is corrupt: %v", err)
+	}
+	for _, e := range entries {
+		idx.entries[e.URL] = e
+	}
+	return idx, nil
+}
+
+func (idx *Index) indexPath() string {
+	return filepath.Join(idx.dir, "cache.json")
+}
+
+func (idx *Index) path(sha string) string {
+	return filepath.Join(idx.dir, sha+".zip")
+}
+
+func (idx *Index) save() error {
+	entries := make([]Entry, 0, len(idx.entries))
+	for _, e := range idx.entries {
+		entries = append(entries, e)
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal cache index: %v", err)
+	}
+	return ioutil.WriteFile(idx.indexPath(), data, 0644)
+}
+
+// Fetch returns the cached bytes for url if they're present and still hash
+// to the recorded checksum. Otherwise it calls download, records the
+// result under its sha256, and returns that. Safe for concurrent use by
+// upgrade's per-addon goroutines; download itself runs outside the lock so
+// concurrent misses don't serialize on the network.
+func (idx *Index) Fetch(name, typ, version, url string, download func() ([]byte, error)) ([]byte, error) {
+	idx.mu.Lock()
+	e, ok := idx.entries[url]
+	idx.mu.Unlock()
+	if ok {
+		if b, err := ioutil.ReadFile(idx.path(e.SHA256)); err == nil && sha256Hex(b) == e.SHA256 {
+			return b, nil
+		}
+		idx.mu.Lock()
+		delete(idx.entries, url)
+		idx.mu.Unlock()
+	}
+
+	b, err := download()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256Hex(b)
+	if err := ioutil.WriteFile(idx.path(sum), b, 0644); err != nil {
+		return nil, fmt.Errorf("unable to write cache entry: %v", err)
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.entries[url] = Entry{
+		Name:      name,
+		Type:      typ,
+		Version:   version,
+		SHA256:    sum,
+		Size:      int64(len(b)),
+		FetchedAt: time.Now(),
+		URL:       url,
+	}
+	return b, idx.save()
+}
+
+// Lookup returns the recorded entry for url, if any.
+func (idx *Index) Lookup(url string) (Entry, bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	e, ok := idx.entries[url]
+	return e, ok
+}
+
+// Offline returns the cached bytes for url, failing if nothing is cached.
+// Used by --offline so upgrade never touches the network.
+func (idx *Index) Offline(url string) ([]byte, error) {
+	idx.mu.Lock()
+	e, ok := idx.entries[url]
+	idx.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no cached copy of %v", url)
+	}
+	b, err := ioutil.ReadFile(idx.path(e.SHA256))
+	if err != nil {
+		return nil, fmt.Errorf("cached copy of %v is missing: %v", url, err)
+	}
+	if sha256Hex(b) != e.SHA256 {
+		return nil, fmt.Errorf("cached copy of %v is corrupt", url)
+	}
+	return b, nil
+}
+
+// Verify rehashes every cached file against its recorded checksum, pruning
+// any entry whose file is missing or corrupt and returning what it pruned.
+func (idx *Index) Verify() ([]Entry, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	var bad []Entry
+	for url, e := range idx.entries {
+		b, err := ioutil.ReadFile(idx.path(e.SHA256))
+		if err != nil || sha256Hex(b) != e.SHA256 {
+			bad = append(bad, e)
+			delete(idx.entries, url)
+			os.Remove(idx.path(e.SHA256))
+		}
+	}
+	return bad, idx.save()
+}
+
+// GC drops (and deletes the backing file for) any entry whose name/type
+// keep reports as no longer referenced by an installation.
+func (idx *Index) GC(keep func(name, typ string) bool) ([]Entry, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	var removed []Entry
+	for url, e := range idx.entries {
+		if keep(e.Name, e.Type) {
+			continue
+		}
+		os.Remove(idx.path(e.SHA256))
+		delete(idx.entries, url)
+		removed = append(removed, e)
+	}
+	return removed, idx.save()
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,228 @@
+package cache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestFetchConcurrent exercises the case upgrade relies on: many addons
+// fetched at once through the same Index. Run with -race; it only proves
+// anything under that flag.
+func TestFetchConcurrent(t *testing.T) {
+	idx, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 32; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			url := fmt.Sprintf("https://example.com/addon-%d.zip", i)
+			_, err := idx.Fetch(fmt.Sprintf("addon-%d", i), "test", "1.0", url, func() ([]byte, error) {
+				return []byte(fmt.Sprintf("content-%d", i)), nil
+			})
+			if err != nil {
+				t.Errorf("Fetch: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < 32; i++ {
+		if _, ok := idx.Lookup(fmt.Sprintf("https://example.com/addon-%d.zip", i)); !ok {
+			t.Errorf("addon-%d missing from index after concurrent fetch", i)
+		}
+	}
+}
+
+// TestOffline covers the --offline flag's only code path: a cached URL
+// returns its bytes without calling download, and an uncached one fails
+// instead of silently falling through to the network.
+func TestOffline(t *testing.T) {
+	idx, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	url := "https://example.com/addon.zip"
+	if _, err := idx.Fetch("addon", "test", "1.0", url, func() ([]byte, error) {
+		return []byte("content"), nil
+	}); err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+
+	b, err := idx.Offline(url)
+	if err != nil {
+		t.Fatalf("Offline on a cached url: %v", err)
+	}
+	if string(b) != "content" {
+		t.Fatalf("Offline returned %q, want %q", b, "content")
+	}
+
+	if _, err := idx.Offline("https://example.com/uncached.zip"); err == nil {
+		t.Fatal("expected Offline to fail for a url with no cached copy")
+	}
+}
+
+// TestOfflineRejectsCorruptEntry covers Offline's own integrity check: a
+// cached file that no longer hashes to its recorded checksum must be
+// refused rather than handed back corrupt.
+func TestOfflineRejectsCorruptEntry(t *testing.T) {
+	dir := t.TempDir()
+	idx, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	url := "https://example.com/addon.zip"
+	if _, err := idx.Fetch("addon", "test", "1.0", url, func() ([]byte, error) {
+		return []byte("content"), nil
+	}); err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+
+	e, _ := idx.Lookup(url)
+	if err := ioutil.WriteFile(filepath.Join(dir, e.SHA256+".zip"), []byte("corrupted"), 0644); err != nil {
+		t.Fatalf("corrupt backing file: %v", err)
+	}
+
+	if _, err := idx.Offline(url); err == nil {
+		t.Fatal("expected Offline to reject a cached file that no longer matches its checksum")
+	}
+}
+
+// TestVerifyPrunesCorruptEntry covers `wpm cache verify`: a corrupt backing
+// file is reported and dropped from the index, and a clean one survives.
+func TestVerifyPrunesCorruptEntry(t *testing.T) {
+	dir := t.TempDir()
+	idx, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	goodURL := "https://example.com/good.zip"
+	badURL := "https://example.com/bad.zip"
+	if _, err := idx.Fetch("good", "test", "1.0", goodURL, func() ([]byte, error) {
+		return []byte("good content"), nil
+	}); err != nil {
+		t.Fatalf("Fetch good: %v", err)
+	}
+	if _, err := idx.Fetch("bad", "test", "1.0", badURL, func() ([]byte, error) {
+		return []byte("bad content"), nil
+	}); err != nil {
+		t.Fatalf("Fetch bad: %v", err)
+	}
+
+	bad, _ := idx.Lookup(badURL)
+	if err := ioutil.WriteFile(filepath.Join(dir, bad.SHA256+".zip"), []byte("tampered"), 0644); err != nil {
+		t.Fatalf("corrupt backing file: %v", err)
+	}
+
+	pruned, err := idx.Verify()
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if len(pruned) != 1 || pruned[0].URL != badURL {
+		t.Fatalf("Verify pruned = %v, want exactly %v", pruned, badURL)
+	}
+
+	if _, ok := idx.Lookup(badURL); ok {
+		t.Fatal("corrupt entry should be gone from the index after Verify")
+	}
+	if _, ok := idx.Lookup(goodURL); !ok {
+		t.Fatal("clean entry should survive Verify")
+	}
+	if _, err := os.Stat(filepath.Join(dir, bad.SHA256+".zip")); !os.IsNotExist(err) {
+		t.Fatalf("Verify should have deleted the corrupt backing file, got err=%v", err)
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("re-Open: %v", err)
+	}
+	if _, ok := reopened.Lookup(badURL); ok {
+		t.Fatal("Verify's pruning should have been persisted to cache.json")
+	}
+}
+
+// TestVerifyPrunesMissingFile covers the other corruption Verify guards
+// against: the backing file is gone entirely, not just altered.
+func TestVerifyPrunesMissingFile(t *testing.T) {
+	dir := t.TempDir()
+	idx, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	url := "https://example.com/addon.zip"
+	if _, err := idx.Fetch("addon", "test", "1.0", url, func() ([]byte, error) {
+		return []byte("content"), nil
+	}); err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	e, _ := idx.Lookup(url)
+	if err := os.Remove(filepath.Join(dir, e.SHA256+".zip")); err != nil {
+		t.Fatalf("remove backing file: %v", err)
+	}
+
+	pruned, err := idx.Verify()
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if len(pruned) != 1 || pruned[0].URL != url {
+		t.Fatalf("Verify pruned = %v, want exactly %v", pruned, url)
+	}
+}
+
+// TestGC covers `wpm cache gc`: entries whose name/type keep rejects are
+// dropped and their backing files deleted; entries it accepts are left
+// untouched.
+func TestGC(t *testing.T) {
+	dir := t.TempDir()
+	idx, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	keptURL := "https://example.com/kept.zip"
+	goneURL := "https://example.com/gone.zip"
+	if _, err := idx.Fetch("Kept", "curse", "1.0", keptURL, func() ([]byte, error) {
+		return []byte("kept content"), nil
+	}); err != nil {
+		t.Fatalf("Fetch kept: %v", err)
+	}
+	if _, err := idx.Fetch("Gone", "curse", "1.0", goneURL, func() ([]byte, error) {
+		return []byte("gone content"), nil
+	}); err != nil {
+		t.Fatalf("Fetch gone: %v", err)
+	}
+	gone, _ := idx.Lookup(goneURL)
+
+	removed, err := idx.GC(func(name, typ string) bool { return name == "Kept" })
+	if err != nil {
+		t.Fatalf("GC: %v", err)
+	}
+	if len(removed) != 1 || removed[0].URL != goneURL {
+		t.Fatalf("GC removed = %v, want exactly %v", removed, goneURL)
+	}
+
+	if _, ok := idx.Lookup(goneURL); ok {
+		t.Fatal("unreferenced entry should be gone from the index after GC")
+	}
+	if _, ok := idx.Lookup(keptURL); !ok {
+		t.Fatal("referenced entry should survive GC")
+	}
+	if _, err := os.Stat(filepath.Join(dir, gone.SHA256+".zip")); !os.IsNotExist(err) {
+		t.Fatalf("GC should have deleted the unreferenced backing file, got err=%v", err)
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("re-Open: %v", err)
+	}
+	if _, ok := reopened.Lookup(goneURL); ok {
+		t.Fatal("GC's removal should have been persisted to cache.json")
+	}
+}
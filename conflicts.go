@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/DianeLooney/wpm/resolve"
+)
+
+// tocFiles returns the contents of every .toc file in sp's zip, keyed by
+// its path inside the zip.
+func tocFiles(sp *Specification) map[string][]byte {
+	out := make(map[string][]byte)
+	if sp.zipData == nil {
+		return out
+	}
+	for _, f := range sp.zipData.File {
+		if !strings.HasSuffix(f.Name, ".toc") {
+			continue
+		}
+		rd, err := f.Open()
+		if err != nil {
+			continue
+		}
+		data, err := ioutil.ReadAll(rd)
+		rd.Close()
+		if err != nil {
+			continue
+		}
+		out[f.Name] = data
+	}
+	return out
+}
+
+// resolveAddon builds the minimal view resolve needs out of a downloaded
+// Specification.
+func resolveAddon(sp *Specification) resolve.Addon {
+	return resolve.Addon{
+		Name:      sp.Name,
+		OwnDirs:   sp.ownDirs,
+		Overrides: sp.Overrides,
+		TOC:       tocFiles(sp),
+	}
+}
+
+// checkConflicts reports (but doesn't fix) every directory more than one
+// addon would write.
+func checkConflicts(addons []*Specification) error {
+	resolveAddons := make([]resolve.Addon, len(addons))
+	for i, adn := range addons {
+		resolveAddons[i] = resolveAddon(adn)
+	}
+	conflicts := resolve.Conflicts(resolveAddons)
+	if len(conflicts) == 0 {
+		return nil
+	}
+	for dir, names := range conflicts {
+		fmt.Printf("Conflict: %v would be written by %v\n", dir, strings.Join(names, ", "))
+	}
+	return fmt.Errorf("%v conflicting directories", len(conflicts))
+}
+
+// resolveMissingDeps reports every addon's unmet ## Dependencies:/
+// ## RequiredDeps: entries. When autoDeps is set, it instead resolves each
+// missing name as a CurseForge slug, downloads it, and appends it to
+// addons, repeating until nothing is left missing so a newly-added
+// dependency's own requirements get auto-added too. It fails the whole
+// upgrade (rather than silently no-op-ing on the offending addon) if an
+// auto-added dependency can't actually be fetched, and if a round makes no
+// progress (e.g. a .toc name that never matches anything installable).
+func resolveMissingDeps(addons []*Specification, autoDeps bool) ([]*Specification, error) {
+	attempted := make(map[string]bool)
+	for {
+		resolveAddons := make([]resolve.Addon, len(addons))
+		for i, adn := range addons {
+			resolveAddons[i] = resolveAddon(adn)
+		}
+		missing := resolve.MissingRequired(resolveAddons)
+		if len(missing) == 0 {
+			return addons, nil
+		}
+
+		if !autoDeps {
+			for name, deps := range missing {
+				fmt.Printf("%v is missing required dependencies: %v\n", name, strings.Join(deps, ", "))
+			}
+			return addons, fmt.Errorf("%v addons have unmet dependencies", len(missing))
+		}
+
+		progressed := false
+		for _, deps := range missing {
+			for _, dep := range deps {
+				if attempted[dep] {
+					continue
+				}
+				attempted[dep] = true
+				progressed = true
+				fmt.Printf("Auto-adding missing dependency %v\n", dep)
+				sp := &Specification{Name: dep, Type: "curse"}
+				if err := sp.Download(); err != nil {
+					return addons, fmt.Errorf("unable to auto-add required dependency %v: %v", dep, err)
+				}
+				addons = append(addons, sp)
+			}
+		}
+		if !progressed {
+			for name, deps := range missing {
+				fmt.Printf("%v is still missing required dependencies after auto-adding: %v\n", name, strings.Join(deps, ", "))
+			}
+			return addons, fmt.Errorf("%v addons have unmet dependencies after auto-add", len(missing))
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// fakeDepSource is a Source stub that lets tests drive auto-dependency
+// resolution without touching the network: each addon name maps to either
+// a zip to "download" or a resolve failure.
+type fakeDepSource struct {
+	zips map[string]map[string]string // addon name -> toc path -> contents
+}
+
+func (s fakeDepSource) Resolve(spec *Specification) (Release, error) {
+	if _, ok := s.zips[spec.Name]; !ok {
+		return Release{}, fmt.Errorf("no such addon %v", spec.Name)
+	}
+	return Release{Name: spec.Name, Type: "curse"}, nil
+}
+
+func (s fakeDepSource) Fetch(release Release) (*zip.Reader, error) {
+	files, ok := s.zips[release.Name]
+	if !ok {
+		return nil, fmt.Errorf("no such addon %v", release.Name)
+	}
+	return buildZipFiles(files), nil
+}
+
+// buildZipFiles is buildZip without the *testing.T, for use from Fetch.
+func buildZipFiles(files map[string]string) *zip.Reader {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for name, contents := range files {
+		w, _ := zw.Create(name)
+		w.Write([]byte(contents))
+	}
+	zw.Close()
+	b := buf.Bytes()
+	zr, _ := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	return zr
+}
+
+func withFakeCurseSource(t *testing.T, s Source) {
+	t.Helper()
+	prev := sources["curse"]
+	sources["curse"] = s
+	t.Cleanup(func() { sources["curse"] = prev })
+}
+
+func addonWithTOC(name, toc string) *Specification {
+	sp := &Specification{Name: name, Type: "curse"}
+	sp.zipData = buildZipFiles(map[string]string{name + ".toc": toc})
+	sp.ownDirs = []string{name}
+	return sp
+}
+
+func TestResolveMissingDepsAutoAddsTransitively(t *testing.T) {
+	withFakeCurseSource(t, fakeDepSource{zips: map[string]map[string]string{
+		"Dep1": {"Dep1.toc": "## RequiredDeps: Dep2"},
+		"Dep2": {"Dep2.toc": "## Title: Dep2"},
+	}})
+
+	main := addonWithTOC("Main", "## RequiredDeps: Dep1")
+	addons, err := resolveMissingDeps([]*Specification{main}, true)
+	if err != nil {
+		t.Fatalf("resolveMissingDeps: %v", err)
+	}
+
+	names := make(map[string]bool)
+	for _, a := range addons {
+		names[a.Name] = true
+	}
+	if !names["Dep1"] || !names["Dep2"] {
+		t.Fatalf("expected Dep1 and Dep2 to be auto-added, got %v", names)
+	}
+}
+
+func TestResolveMissingDepsFailsUpgradeOnFetchFailure(t *testing.T) {
+	withFakeCurseSource(t, fakeDepSource{zips: map[string]map[string]string{}})
+
+	main := addonWithTOC("Main", "## RequiredDeps: Missing")
+	_, err := resolveMissingDeps([]*Specification{main}, true)
+	if err == nil {
+		t.Fatal("expected an error when an auto-added dependency can't be fetched")
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+func keyringDir() string {
+	return path.Join(os.Getenv("APPDATA"), "wpm", "keyring")
+}
+
+// signatureFor works out where to fetch a spec's signature from, and which
+// key it must be signed by, given the resolved download url. Specs that
+// configure neither Signature nor PublicKey get no verification.
+func signatureFor(spec *Specification, url string) (sigURL, publicKey string) {
+	if spec.Signature == "" && spec.PublicKey == "" {
+		return "", ""
+	}
+	sigURL = spec.Signature
+	if sigURL == "" {
+		sigURL = url + ".asc"
+	}
+	return sigURL, spec.PublicKey
+}
+
+// addKey reads an armored public key from src and stores it in the
+// keyring under its fingerprint, creating the keyring directory if this is
+// the first key added.
+func addKey(src string) (string, error) {
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return "", fmt.Errorf("unable to read %v: %v", src, err)
+	}
+	el, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("%v is not a valid armored public key: %v", src, err)
+	}
+	if len(el) == 0 {
+		return "", fmt.Errorf("%v contains no keys", src)
+	}
+	id := fmt.Sprintf("%X", el[0].PrimaryKey.Fingerprint)
+	if err := os.MkdirAll(keyringDir(), 0755); err != nil {
+		return "", fmt.Errorf("unable to create keyring dir: %v", err)
+	}
+	if err := ioutil.WriteFile(path.Join(keyringDir(), id+".asc"), data, 0644); err != nil {
+		return "", fmt.Errorf("unable to store key: %v", err)
+	}
+	return id, nil
+}
+
+// listKeys returns the fingerprint of every key in the keyring. It never
+// creates the keyring directory; an untouched keyring just reports empty.
+func listKeys() ([]string, error) {
+	entries, err := ioutil.ReadDir(keyringDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to read keyring: %v", err)
+	}
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(e.Name(), ".asc"))
+	}
+	return ids, nil
+}
+
+// removeKey deletes a key from the keyring by fingerprint. Like listKeys,
+// it never creates the keyring directory: removing from one that doesn't
+// exist is just an error, not a no-op that quietly conjures an empty one.
+func removeKey(id string) error {
+	if _, err := os.Stat(keyringDir()); os.IsNotExist(err) {
+		return fmt.Errorf("no keyring to remove from")
+	}
+	if err := os.Remove(path.Join(keyringDir(), id+".asc")); err != nil {
+		return fmt.Errorf("unable to remove %v: %v", id, err)
+	}
+	return nil
+}
+
+// loadKeyring reads every key currently in the keyring, for verifying
+// signatures against. Like listKeys, it never creates the directory.
+func loadKeyring() (openpgp.EntityList, error) {
+	entries, err := ioutil.ReadDir(keyringDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to read keyring: %v", err)
+	}
+	var all openpgp.EntityList
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		data, err := ioutil.ReadFile(path.Join(keyringDir(), e.Name()))
+		if err != nil {
+			continue
+		}
+		el, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+		if err != nil {
+			continue
+		}
+		all = append(all, el...)
+	}
+	return all, nil
+}
+
+// verifySignature checks data against a detached armored signature using
+// whatever keys are in the keyring. If publicKey is set, the signer's
+// fingerprint must match it exactly; otherwise any keyring key satisfies.
+func verifySignature(data, sig []byte, publicKey string) error {
+	keyring, err := loadKeyring()
+	if err != nil {
+		return err
+	}
+	if len(keyring) == 0 {
+		return fmt.Errorf("no keys in keyring to verify against")
+	}
+	signer, err := openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(data), bytes.NewReader(sig))
+	if err != nil {
+		return fmt.Errorf("no keyring key signed this artifact: %v", err)
+	}
+	if publicKey != "" && fmt.Sprintf("%X", signer.PrimaryKey.Fingerprint) != publicKey {
+		return fmt.Errorf("signed by %X, not the pinned key %v", signer.PrimaryKey.Fingerprint, publicKey)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// withKeyringDir points keyringDir at a fresh temp dir for the duration of
+// the test, so addKey/listKeys/removeKey/loadKeyring never touch a real
+// user's keyring.
+func withKeyringDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	old := os.Getenv("APPDATA")
+	os.Setenv("APPDATA", dir)
+	t.Cleanup(func() { os.Setenv("APPDATA", old) })
+	return path.Join(dir, "wpm", "keyring")
+}
+
+// genKey generates a throwaway PGP entity and writes its armored public key
+// to a file under t.TempDir(), returning the entity (for signing) and the
+// path to the armored key (for addKey).
+func genKey(t *testing.T) (*openpgp.Entity, string) {
+	t.Helper()
+	entity, err := openpgp.NewEntity("wpm-test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatalf("openpgp.NewEntity: %v", err)
+	}
+	buf := &bytes.Buffer{}
+	w, err := armor.Encode(buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatalf("armor.Encode: %v", err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatalf("entity.Serialize: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close armor writer: %v", err)
+	}
+	p := path.Join(t.TempDir(), "key.asc")
+	if err := os.WriteFile(p, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	return entity, p
+}
+
+// sign produces a detached armored signature of data, signed by entity.
+func sign(t *testing.T, entity *openpgp.Entity, data []byte) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	if err := openpgp.ArmoredDetachSign(buf, entity, bytes.NewReader(data), nil); err != nil {
+		t.Fatalf("ArmoredDetachSign: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestSignatureFor(t *testing.T) {
+	spec := &Specification{}
+	if sigURL, pub := signatureFor(spec, "https://example.com/a.zip"); sigURL != "" || pub != "" {
+		t.Fatalf("expected no verification for a spec with neither Signature nor PublicKey, got (%q, %q)", sigURL, pub)
+	}
+
+	spec = &Specification{PublicKey: "ABCD"}
+	sigURL, pub := signatureFor(spec, "https://example.com/a.zip")
+	if sigURL != "https://example.com/a.zip.asc" {
+		t.Fatalf("expected default .asc signature URL, got %q", sigURL)
+	}
+	if pub != "ABCD" {
+		t.Fatalf("expected PublicKey passed through, got %q", pub)
+	}
+
+	spec = &Specification{Signature: "https://example.com/detached.sig"}
+	sigURL, _ = signatureFor(spec, "https://example.com/a.zip")
+	if sigURL != "https://example.com/detached.sig" {
+		t.Fatalf("expected explicit Signature to override the default, got %q", sigURL)
+	}
+}
+
+func TestAddListRemoveKey(t *testing.T) {
+	withKeyringDir(t)
+	entity, keyPath := genKey(t)
+	wantID := fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint)
+
+	id, err := addKey(keyPath)
+	if err != nil {
+		t.Fatalf("addKey: %v", err)
+	}
+	if id != wantID {
+		t.Fatalf("addKey returned %q, want %q", id, wantID)
+	}
+
+	ids, err := listKeys()
+	if err != nil {
+		t.Fatalf("listKeys: %v", err)
+	}
+	sort.Strings(ids)
+	if len(ids) != 1 || ids[0] != wantID {
+		t.Fatalf("listKeys = %v, want [%v]", ids, wantID)
+	}
+
+	if err := removeKey(wantID); err != nil {
+		t.Fatalf("removeKey: %v", err)
+	}
+	ids, err = listKeys()
+	if err != nil {
+		t.Fatalf("listKeys after remove: %v", err)
+	}
+	if len(ids) != 0 {
+		t.Fatalf("listKeys after remove = %v, want empty", ids)
+	}
+}
+
+func TestListKeysEmptyKeyringDoesNotCreateDir(t *testing.T) {
+	dir := withKeyringDir(t)
+	if _, err := listKeys(); err != nil {
+		t.Fatalf("listKeys on untouched keyring: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("listKeys should not create the keyring dir, got err=%v", err)
+	}
+}
+
+func TestRemoveKeyNoKeyring(t *testing.T) {
+	withKeyringDir(t)
+	if err := removeKey("DEADBEEF"); err == nil {
+		t.Fatal("expected removeKey to fail against a keyring that was never created")
+	}
+}
+
+func TestVerifySignatureAccepted(t *testing.T) {
+	withKeyringDir(t)
+	entity, keyPath := genKey(t)
+	if _, err := addKey(keyPath); err != nil {
+		t.Fatalf("addKey: %v", err)
+	}
+
+	data := []byte("addon contents")
+	sig := sign(t, entity, data)
+
+	if err := verifySignature(data, sig, ""); err != nil {
+		t.Fatalf("verifySignature with no pinned key: %v", err)
+	}
+
+	wantID := fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint)
+	if err := verifySignature(data, sig, wantID); err != nil {
+		t.Fatalf("verifySignature pinned to the signer: %v", err)
+	}
+}
+
+func TestVerifySignatureRejectsTamperedData(t *testing.T) {
+	withKeyringDir(t)
+	entity, keyPath := genKey(t)
+	if _, err := addKey(keyPath); err != nil {
+		t.Fatalf("addKey: %v", err)
+	}
+
+	sig := sign(t, entity, []byte("addon contents"))
+
+	if err := verifySignature([]byte("tampered contents"), sig, ""); err == nil {
+		t.Fatal("expected verifySignature to reject data that doesn't match the signature")
+	}
+}
+
+func TestVerifySignatureRejectsWrongPinnedKey(t *testing.T) {
+	withKeyringDir(t)
+	entity, keyPath := genKey(t)
+	if _, err := addKey(keyPath); err != nil {
+		t.Fatalf("addKey: %v", err)
+	}
+
+	data := []byte("addon contents")
+	sig := sign(t, entity, data)
+
+	if err := verifySignature(data, sig, "0000000000000000000000000000000000000000"); err == nil {
+		t.Fatal("expected verifySignature to reject a signature from a key other than the pinned one")
+	}
+}
+
+func TestVerifySignatureNoKeysInKeyring(t *testing.T) {
+	withKeyringDir(t)
+	entity, _ := genKey(t)
+	data := []byte("addon contents")
+	sig := sign(t, entity, data)
+
+	if err := verifySignature(data, sig, ""); err == nil {
+		t.Fatal("expected verifySignature to fail with an empty keyring")
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// LockEntry is what wpm actually installed for one addon, so a later
+// upgrade can detect drift or pin back to it.
+type LockEntry struct {
+	Version     string
+	ReleaseType string
+	SHA256      string
+	ResolvedURL string
+	ResolvedAt  time.Time
+	Files       []string
+}
+
+// InstallationLock mirrors an Installation but records resolved state
+// instead of configuration.
+type InstallationLock struct {
+	Dir    string
+	Addons map[string]LockEntry
+}
+
+// Lock is the on-disk wpm.lock.yaml.
+type Lock struct {
+	Installations []InstallationLock
+}
+
+func lockLocation() string {
+	return path.Join(os.Getenv("APPDATA"), "wpm", "wpm.lock.yaml")
+}
+
+func historyDir() string {
+	return path.Join(os.Getenv("APPDATA"), "wpm", "history")
+}
+
+func readLock() (*Lock, error) {
+	d, err := ioutil.ReadFile(lockLocation())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Lock{}, nil
+		}
+		return nil, errFileNotFound
+	}
+	lock := Lock{}
+	if err := yaml.Unmarshal(d, &lock); err != nil {
+		return nil, errFileFormat
+	}
+	return &lock, nil
+}
+
+// saveLock archives the current wpm.lock.yaml under history/ (if it exists)
+// before writing the new one, so rollback has a prior generation to
+// restore.
+func saveLock(l *Lock) error {
+	if d, err := ioutil.ReadFile(lockLocation()); err == nil {
+		if err := os.MkdirAll(historyDir(), 0755); err != nil {
+			return fmt.Errorf("unable to create history dir: %v", err)
+		}
+		snapshot := path.Join(historyDir(), fmt.Sprintf("%v.wpm.lock.yaml", time.Now().UTC().Format("20060102T150405.000000000")))
+		if err := ioutil.WriteFile(snapshot, d, 0644); err != nil {
+			return fmt.Errorf("unable to archive previous lockfile: %v", err)
+		}
+	}
+
+	d, err := yaml.Marshal(l)
+	if err != nil {
+		return fmt.Errorf("unable to create yaml: %v", err)
+	}
+	return ioutil.WriteFile(lockLocation(), d, 0644)
+}
+
+// lockEntryFor finds the addon's prior lock entry, if any.
+func (l *Lock) lockEntryFor(dir, name string) (LockEntry, bool) {
+	for _, inst := range l.Installations {
+		if inst.Dir != dir {
+			continue
+		}
+		e, ok := inst.Addons[name]
+		return e, ok
+	}
+	return LockEntry{}, false
+}
+
+// rollback restores wpm.lock.yaml from the most recent snapshot under
+// history/, returning the snapshot's filename.
+func rollback() (string, error) {
+	entries, err := ioutil.ReadDir(historyDir())
+	if err != nil {
+		return "", fmt.Errorf("no lockfile history to roll back to: %v", err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		names = append(names, e.Name())
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("no lockfile history to roll back to")
+	}
+	sort.Strings(names)
+	latest := names[len(names)-1]
+
+	d, err := ioutil.ReadFile(path.Join(historyDir(), latest))
+	if err != nil {
+		return "", fmt.Errorf("unable to read snapshot %v: %v", latest, err)
+	}
+	if err := ioutil.WriteFile(lockLocation(), d, 0644); err != nil {
+		return "", fmt.Errorf("unable to restore snapshot %v: %v", latest, err)
+	}
+	return latest, nil
+}
@@ -2,19 +2,17 @@ package main
 
 import (
 	"archive/zip"
-	"bytes"
 	"flag"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"path"
 	"sort"
 	"sync"
+	"time"
 
-	"github.com/PuerkitoBio/goquery"
+	"github.com/DianeLooney/wpm/cache"
 	yaml "gopkg.in/yaml.v2"
 )
 
@@ -28,13 +26,20 @@ type Installation struct {
 }
 
 type Specification struct {
-	Name     string
-	Type     string
-	Location string `yaml:",omitempty"`
-	Branch   string `yaml:",omitempty"`
-
-	zipData *zip.Reader `yaml:"-"`
-	ownDirs []string    `yaml:"-"`
+	Name      string
+	Type      string
+	Location  string   `yaml:",omitempty"`
+	Branch    string   `yaml:",omitempty"`
+	Pattern   string   `yaml:",omitempty"`
+	Version   string   `yaml:",omitempty"`
+	Channel   string   `yaml:",omitempty"`
+	Overrides []string `yaml:",omitempty"`
+	Signature string   `yaml:",omitempty"`
+	PublicKey string   `yaml:",omitempty"`
+
+	zipData  *zip.Reader `yaml:"-"`
+	ownDirs  []string    `yaml:"-"`
+	resolved Release     `yaml:"-"`
 }
 
 var errFileNotFound = fmt.Errorf("wpm: file not found")
@@ -148,206 +153,336 @@ func main() {
 			log.Fatalf("Unable to load wpm.yaml: %v\n", err)
 		}
 
+		fset := flag.NewFlagSet("upgrade args", flag.ContinueOnError)
+		off := fset.Bool("offline", false, "only use cached artifacts, never hit the network")
+		frozen := fset.Bool("frozen", false, "fail if resolution would change the lockfile")
+		update := fset.Bool("update", false, "only bump addons named as positional args, pinning the rest to the lock")
+		force := fset.Bool("force", false, "install despite directory conflicts between addons")
+		autoDeps := fset.Bool("auto-deps", false, "automatically install missing required dependencies")
+		reqSig := fset.Bool("require-signatures", false, "refuse to install any downloaded addon that has no signature to verify")
+		fset.Parse(args[1:])
+		offline = *off
+		requireSignatures = *reqSig
+		updateOnly := fset.Args()
+
+		dlCache, err = cache.Open(cache.Dir())
+		if err != nil {
+			log.Fatalf("Unable to open download cache: %v\n", err)
+		}
+
+		lock, err := readLock()
+		if err != nil {
+			log.Fatalf("Unable to load wpm.lock.yaml: %v\n", err)
+		}
+
+		if *update {
+			wanted := make(map[string]bool, len(updateOnly))
+			for _, n := range updateOnly {
+				wanted[n] = true
+			}
+			for _, adn := range m.Installations[0].Addons {
+				if wanted[adn.Name] || adn.Version != "" {
+					continue
+				}
+				if e, ok := lock.lockEntryFor(m.Installations[0].Dir, adn.Name); ok {
+					adn.Version = "==" + e.Version
+				}
+			}
+		}
+
 		wg := sync.WaitGroup{}
+		dlErrs := make([]error, len(m.Installations[0].Addons))
 		wg.Add(len(m.Installations[0].Addons))
-		for _, adn := range m.Installations[0].Addons {
-			go func(adn *Specification) {
+		for i, adn := range m.Installations[0].Addons {
+			go func(i int, adn *Specification) {
 				defer wg.Done()
-				adn.Download()
-			}(adn)
+				dlErrs[i] = adn.Download()
+			}(i, adn)
 		}
 		wg.Wait()
 
-		//todo: check for conflicts
+		downloadOK := true
+		for i, err := range dlErrs {
+			if err != nil {
+				fmt.Printf("[download] %v: %v\n", m.Installations[0].Addons[i].Name, err)
+				downloadOK = false
+			}
+		}
+		if !downloadOK {
+			log.Fatalf("Upgrade failed; lockfile left unchanged\n")
+		}
+
+		if *frozen {
+			for _, adn := range m.Installations[0].Addons {
+				e, ok := lock.lockEntryFor(m.Installations[0].Dir, adn.Name)
+				if !ok {
+					continue
+				}
+				if adn.resolved.Version != e.Version || adn.resolved.URL != e.ResolvedURL {
+					log.Fatalf("Resolution for %v would change the lock (%v -> %v); refusing due to --frozen\n", adn.Name, e.Version, adn.resolved.Version)
+				}
+			}
+		}
 
+		addons := m.Installations[0].Addons
+		addons, err = resolveMissingDeps(addons, *autoDeps)
+		if err != nil {
+			log.Fatalf("%v\n", err)
+		}
+		m.Installations[0].Addons = addons
+
+		if err := checkConflicts(addons); err != nil {
+			if !*force {
+				log.Fatalf("%v; pass --force or declare Overrides to install anyway\n", err)
+			}
+			fmt.Printf("Proceeding despite conflicts due to --force\n")
+		}
+
+		txs := make([]*AddonTransaction, len(addons))
 		wg = sync.WaitGroup{}
-		for _, adn := range m.Installations[0].Addons {
-			wg.Add(1)
-			go func(adn *Specification) {
+		wg.Add(len(addons))
+		for i, adn := range addons {
+			go func(i int, adn *Specification) {
 				defer wg.Done()
-				delta := adn.PlanChanges(m.Installations[0].Dir)
-				for _, d := range delta {
-					d.commit()
-				}
-			}(adn)
+				txs[i] = adn.PlanChanges(m.Installations[0].Dir)
+			}(i, adn)
 		}
 		wg.Wait()
-	}
-}
 
-type pack struct {
-	ownDirs []string
-	data    *zip.Reader
-}
+		prepared := true
+		for i, adn := range addons {
+			if err := txs[i].Prepare(); err != nil {
+				fmt.Printf("[prepare] %v: %v\n", adn.Name, err)
+				prepared = false
+			}
+		}
 
-func (sp *Specification) Download() {
-	switch sp.Type {
-	case "curse":
-		fallthrough
-	case "wowace":
-		var u string
-		switch sp.Type {
-		case "curse":
-			u = fmt.Sprintf("https://wow.curseforge.com/projects/%v/files", sp.Name)
-		case "wowace":
-			u = fmt.Sprintf("https://www.wowace.com/projects/%v/files", sp.Name)
+		upgradeOK := prepared
+		if !prepared {
+			fmt.Println("Aborting upgrade: one or more addons failed to prepare")
+			for _, tx := range txs {
+				tx.Rollback()
+			}
+		} else {
+			committed := make([]*AddonTransaction, 0, len(txs))
+			for i, adn := range addons {
+				if err := txs[i].Commit(); err != nil {
+					fmt.Printf("[commit] %v: %v\n", adn.Name, err)
+					txs[i].Rollback()
+					upgradeOK = false
+					break
+				}
+				committed = append(committed, txs[i])
+			}
+			if !upgradeOK {
+				fmt.Println("Rolling back already-committed addons")
+				for i := len(committed) - 1; i >= 0; i-- {
+					if err := committed[i].Rollback(); err != nil {
+						fmt.Printf("[rollback] %v: %v\n", committed[i].name, err)
+					}
+				}
+			} else {
+				for _, tx := range txs {
+					tx.Cleanup()
+				}
+			}
 		}
-		if u == "" {
-			return
+
+		if !upgradeOK {
+			log.Fatalf("Upgrade failed; lockfile left unchanged\n")
 		}
 
-		resp, err := http.Get(u)
-		if err != nil {
-			fmt.Printf("Unable to get the index for %v: %v\n", sp.Name, err)
-			return
+		if err := saveLock(buildLock(m.Installations)); err != nil {
+			fmt.Printf("Unable to save lockfile: %v\n", err)
 		}
-		defer resp.Body.Close()
-		doc, err := goquery.NewDocumentFromReader(resp.Body)
+	case "cache":
+		if len(args) < 2 {
+			log.Fatalf("wpm cache requires a subcommand: verify, gc\n")
+		}
+		idx, err := cache.Open(cache.Dir())
 		if err != nil {
-			fmt.Printf("Unable to parse the returned document into goquery: %v", err)
-			return
+			log.Fatalf("Unable to open download cache: %v\n", err)
 		}
-		items := doc.Find("table.project-file-listing tr.project-file-list-item")
-		items.First().Each(func(i int, s *goquery.Selection) {
-			//phase, _ := s.Find("td.project-file-release-type>div").Attr("class")
-			href, _ := s.Find("div.project-file-download-button a.button.tip.fa-icon-download").Attr("href")
-			switch sp.Type {
-			case "curse":
-				href = "https://wow.curseforge.com" + href
-			case "wowace":
-				href = "https://www.wowace.com" + href
-			}
-			r, err := http.Get(href)
+		switch args[1] {
+		case "verify":
+			bad, err := idx.Verify()
 			if err != nil {
-				fmt.Printf("Error getting zip.")
-				return
+				log.Fatalf("Unable to verify cache: %v\n", err)
 			}
-			b, _ := ioutil.ReadAll(r.Body)
-			rd := bytes.NewReader(b)
-			sp.zipData, _ = zip.NewReader(rd, r.ContentLength)
-		})
-		dirs := make(map[string]struct{})
-		yes := struct{}{}
-		for _, f := range sp.zipData.File {
-			if f.Name == "." {
-				continue
+			for _, e := range bad {
+				fmt.Printf("Pruned corrupt cache entry for %v (%v)\n", e.Name, e.URL)
 			}
-			dir, _ := path.Split(f.Name)
-			for {
-				nxt := path.Join(dir, "..")
-				if nxt == "." {
-					break
+			fmt.Printf("Verified cache, pruned %v entries\n", len(bad))
+		case "gc":
+			m, err := readConfig()
+			if err != nil {
+				log.Fatalf("Unable to load wpm.yaml: %v\n", err)
+			}
+			keep := func(name, typ string) bool {
+				for _, inst := range m.Installations {
+					for _, adn := range inst.Addons {
+						if adn.Name == name && adn.Type == typ {
+							return true
+						}
+					}
 				}
-				dir = nxt
+				return false
 			}
-			dirs[dir] = yes
-		}
-		sp.ownDirs = make([]string, 0)
-		for i := range dirs {
-			sp.ownDirs = append(sp.ownDirs, i)
-		}
-	case "ignore":
-		sp.ownDirs = []string{sp.Name}
-	case "link":
-		sp.ownDirs = []string{sp.Name}
-	}
-}
-
-func (sp *Specification) PlanChanges(base string) []commiter {
-	switch sp.Type {
-	case "curse":
-		fallthrough
-	case "wowace":
-		dirs := make(map[string]bool)
-		if sp.zipData == nil {
-			fmt.Println("nil data")
-			return make([]commiter, 0)
-		}
-		for _, f := range sp.zipData.File {
-			pth := path.Dir(f.Name)
-			for pth != "." {
-				dirs[pth] = true
-				pth = path.Dir(pth)
+			removed, err := idx.GC(keep)
+			if err != nil {
+				log.Fatalf("Unable to gc cache: %v\n", err)
 			}
+			for _, e := range removed {
+				fmt.Printf("Removed unreferenced cache entry for %v (%v)\n", e.Name, e.URL)
+			}
+			fmt.Printf("Collected %v unreferenced entries\n", len(removed))
+		default:
+			log.Fatalf("Unknown cache subcommand %q\n", args[1])
 		}
-		dirSl := make([]string, len(dirs))
-		i := 0
-		for k := range dirs {
-			dirSl[i] = k
-			i++
-		}
-		sort.Strings(dirSl)
-		retval := make([]commiter, 0)
-		for _, d := range sp.ownDirs {
-			retval = append(retval, fsRmdir{path.Join(base, d)})
+	case "rollback":
+		snapshot, err := rollback()
+		if err != nil {
+			log.Fatalf("Unable to roll back: %v\n", err)
 		}
-		for _, s := range dirSl {
-			retval = append(retval, fsMkdir{path.Join(base, s)})
+		fmt.Printf("Restored wpm.lock.yaml from %v\n", snapshot)
+	case "keyring":
+		if len(args) < 2 {
+			log.Fatalf("wpm keyring requires a subcommand: add, list, remove\n")
 		}
-		for _, f := range sp.zipData.File {
-			if f.FileInfo().IsDir() {
-				continue
+		switch args[1] {
+		case "add":
+			if len(args) < 3 {
+				log.Fatalf("wpm keyring add requires a path to an armored public key\n")
+			}
+			id, err := addKey(args[2])
+			if err != nil {
+				log.Fatalf("Unable to add key: %v\n", err)
+			}
+			fmt.Printf("Added key %v\n", id)
+		case "list":
+			ids, err := listKeys()
+			if err != nil {
+				log.Fatalf("Unable to list keyring: %v\n", err)
+			}
+			if len(ids) == 0 {
+				fmt.Println("Keyring is empty")
+			}
+			for _, id := range ids {
+				fmt.Println(id)
+			}
+		case "remove":
+			if len(args) < 3 {
+				log.Fatalf("wpm keyring remove requires a key fingerprint\n")
+			}
+			if err := removeKey(args[2]); err != nil {
+				log.Fatalf("Unable to remove key: %v\n", err)
 			}
-			rd, _ := f.Open()
-			retval = append(retval, fsWritefile{path.Join(base, f.Name), rd})
+			fmt.Printf("Removed key %v\n", args[2])
+		default:
+			log.Fatalf("Unknown keyring subcommand %q\n", args[1])
 		}
-		return retval
-	case "ignore":
-		return make([]commiter, 0)
-	case "link":
-		ret := make([]commiter, 2)
-		ret[0] = fsRmdir{path.Join(base, sp.Name)}
-		ret[1] = fsLink{sp.Location, path.Join(base, sp.Name)}
-		return ret
 	}
-	return make([]commiter, 0)
-}
-
-// Commiters
-
-type commiter interface {
-	commit() error
-}
-
-type fsRmdir struct {
-	loc string
-}
-
-func (a fsRmdir) commit() error {
-	return os.RemoveAll(a.loc)
 }
 
-type fsRm struct {
-	loc string
-}
-
-func (a fsRm) commit() error {
-	return os.Remove(a.loc)
+type pack struct {
+	ownDirs []string
+	data    *zip.Reader
 }
 
-type fsMkdir struct {
-	loc string
+// buildLock records a LockEntry for every addon that was actually
+// downloaded this upgrade (adn.zipData != nil): the version, checksum, and
+// file list that justify recreating it bit-for-bit on a future
+// `upgrade --frozen`. Addons whose Source has nothing to download at all
+// (e.g. "link", "ignore") are skipped, same as they always have been.
+// Callers must only reach this once every addon's Download has succeeded:
+// an addon left nil by a failed Download is indistinguishable here from one
+// that was never meant to have a zip, so an aborted upgrade must not call
+// this for the addons it never finished downloading.
+func buildLock(installations []Installation) *Lock {
+	lock := &Lock{Installations: make([]InstallationLock, len(installations))}
+	for i, inst := range installations {
+		lock.Installations[i].Dir = inst.Dir
+		lock.Installations[i].Addons = make(map[string]LockEntry)
+		for _, adn := range inst.Addons {
+			if adn.zipData == nil {
+				continue
+			}
+			files := make([]string, 0)
+			for _, f := range adn.zipData.File {
+				if f.FileInfo().IsDir() {
+					continue
+				}
+				files = append(files, f.Name)
+			}
+			sort.Strings(files)
+			lock.Installations[i].Addons[adn.Name] = LockEntry{
+				Version:     adn.resolved.Version,
+				ReleaseType: adn.Channel,
+				SHA256:      adn.resolved.Checksum,
+				ResolvedURL: adn.resolved.URL,
+				ResolvedAt:  time.Now(),
+				Files:       files,
+			}
+		}
+	}
+	return lock
 }
 
-func (a fsMkdir) commit() error {
-	return os.Mkdir(a.loc, 0666)
-}
+// Download resolves and fetches sp against its registered Source, leaving
+// sp.zipData/sp.resolved/sp.ownDirs set on success. A non-nil error means sp
+// was left untouched and must not be treated as installed, planned, or
+// recorded in the lockfile by the caller. A source whose Fetch legitimately
+// has nothing to download (e.g. "link", "ignore") returns (nil, nil) and is
+// not an error: sp.zipData stays nil but sp.ownDirs is still set.
+func (sp *Specification) Download() error {
+	src, ok := sources[sp.Type]
+	if !ok {
+		return fmt.Errorf("unknown source type %q for %v", sp.Type, sp.Name)
+	}
 
-type fsWritefile struct {
-	loc  string
-	data io.Reader
-}
+	release, err := src.Resolve(sp)
+	if err != nil {
+		return fmt.Errorf("unable to resolve %v: %v", sp.Name, err)
+	}
 
-func (f fsWritefile) commit() error {
-	data, _ := ioutil.ReadAll(f.data)
-	return ioutil.WriteFile(f.loc, data, 0644)
+	zr, err := src.Fetch(release)
+	if err != nil {
+		return fmt.Errorf("unable to fetch %v: %v", sp.Name, err)
+	}
+	if zr == nil {
+		sp.ownDirs = []string{sp.Name}
+		return nil
+	}
+	if dlCache != nil {
+		if e, ok := dlCache.Lookup(release.URL); ok {
+			release.Checksum = e.SHA256
+		}
+	}
+	sp.resolved = release
+	sp.zipData = zr
+	sp.ownDirs = ownDirsFromZip(zr)
+	return nil
 }
 
-type fsLink struct {
-	src string
-	dst string
-}
+// PlanChanges builds the transaction that will install sp into base. Nothing
+// is written to the live installation until the caller runs Prepare and
+// Commit on the result.
+func (sp *Specification) PlanChanges(base string) *AddonTransaction {
+	tx := newAddonTransaction(sp.Name, base)
+	if sp.Type == "link" {
+		tx.link = &linkPlan{src: sp.Location, dir: sp.Name}
+		return tx
+	}
+	if sp.zipData == nil {
+		return tx
+	}
 
-func (f fsLink) commit() error {
-	return os.Link(f.src, f.dst)
+	tx.dirs = sp.ownDirs
+	for _, f := range sp.zipData.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		tx.files[f.Name] = f
+	}
+	return tx
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// failingSource is a fake Source used to exercise Download's error paths
+// without touching the network.
+type failingSource struct {
+	resolveErr error
+	fetchErr   error
+}
+
+func (s failingSource) Resolve(spec *Specification) (Release, error) {
+	if s.resolveErr != nil {
+		return Release{}, s.resolveErr
+	}
+	return Release{}, nil
+}
+
+func (s failingSource) Fetch(release Release) (*zip.Reader, error) {
+	return nil, s.fetchErr
+}
+
+func TestDownloadUnknownSourceType(t *testing.T) {
+	sp := &Specification{Name: "Foo", Type: "no-such-backend"}
+	if err := sp.Download(); err == nil {
+		t.Fatal("expected Download to fail for an unregistered source type")
+	}
+	if sp.zipData != nil {
+		t.Fatal("expected zipData to stay nil after a failed Download")
+	}
+}
+
+func TestDownloadResolveFailure(t *testing.T) {
+	registerSource("test-resolve-fail", failingSource{resolveErr: fmt.Errorf("boom")})
+	sp := &Specification{Name: "Foo", Type: "test-resolve-fail"}
+	if err := sp.Download(); err == nil {
+		t.Fatal("expected Download to surface a Resolve failure instead of swallowing it")
+	}
+	if sp.zipData != nil {
+		t.Fatal("expected zipData to stay nil after a failed Resolve")
+	}
+}
+
+func TestDownloadFetchFailure(t *testing.T) {
+	registerSource("test-fetch-fail", failingSource{fetchErr: fmt.Errorf("boom")})
+	sp := &Specification{Name: "Foo", Type: "test-fetch-fail"}
+	if err := sp.Download(); err == nil {
+		t.Fatal("expected Download to surface a Fetch failure instead of swallowing it")
+	}
+	if sp.zipData != nil {
+		t.Fatal("expected zipData to stay nil after a failed Fetch")
+	}
+}
+
+// TestBuildLockSkipsUndownloadedAddon covers the upgrade lock-save path this
+// request introduced: buildLock must only record the addon that actually
+// came back with a zip, never one left nil by a failed (or never-run)
+// Download, so a transient download failure can't silently erase that
+// addon's version/checksum history from wpm.lock.yaml.
+func TestBuildLockSkipsUndownloadedAddon(t *testing.T) {
+	ok := &Specification{Name: "Ok", Channel: "release"}
+	ok.zipData = zipReaderFrom(t, "Ok/Ok.lua")
+	ok.resolved = Release{Version: "1.0.0", Checksum: "abc123", URL: "https://example.com/ok.zip"}
+
+	failed := &Specification{Name: "Failed", Type: "test-resolve-fail"}
+	// Simulates the addon whose Download errored this upgrade: left exactly
+	// as Download leaves it on failure, never touched further.
+
+	lock := buildLock([]Installation{{Dir: "C:\\AddOns", Addons: []*Specification{ok, failed}}})
+
+	if len(lock.Installations) != 1 {
+		t.Fatalf("expected 1 installation in the lock, got %v", len(lock.Installations))
+	}
+	entries := lock.Installations[0].Addons
+	if _, present := entries["Failed"]; present {
+		t.Fatal("buildLock recorded a lock entry for an addon that was never downloaded")
+	}
+	entry, present := entries["Ok"]
+	if !present {
+		t.Fatal("buildLock dropped the lock entry for an addon that downloaded successfully")
+	}
+	if entry.Version != "1.0.0" || entry.SHA256 != "abc123" {
+		t.Fatalf("buildLock entry = %+v, want version 1.0.0 / checksum abc123", entry)
+	}
+}
+
+// zipReaderFrom builds a one-entry in-memory zip, for tests that need a
+// Specification with non-nil zipData but don't care about its contents.
+func zipReaderFrom(t *testing.T, name string) *zip.Reader {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	w, err := zw.Create(name)
+	if err != nil {
+		t.Fatalf("zw.Create: %v", err)
+	}
+	if _, err := w.Write([]byte("-- contents")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zw.Close: %v", err)
+	}
+	b := buf.Bytes()
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("zip.NewReader: %v", err)
+	}
+	return zr
+}
@@ -0,0 +1,121 @@
+// Package resolve checks a set of about-to-be-installed addons for
+// directory conflicts and unmet .toc dependencies before anything touches
+// the filesystem.
+package resolve
+
+import "strings"
+
+// Addon is the minimal view of an addon that conflict and dependency
+// resolution needs; the caller builds these from its own addon/spec type.
+type Addon struct {
+	Name      string
+	OwnDirs   []string
+	Overrides []string          // directories this addon is allowed to share with another
+	TOC       map[string][]byte // .toc path -> contents, for every .toc in the addon's zip
+}
+
+// Dependencies are the addon names pulled out of a .toc's
+// ## Dependencies:/## RequiredDeps:/## OptionalDeps: lines.
+type Dependencies struct {
+	Required []string
+	Optional []string
+}
+
+// Conflicts returns, for every directory more than one addon would write,
+// the names of the addons that would write it. A directory declared in
+// every writer's Overrides is not reported.
+func Conflicts(addons []Addon) map[string][]string {
+	owners := make(map[string][]string)
+	for _, a := range addons {
+		for _, d := range a.OwnDirs {
+			owners[d] = append(owners[d], a.Name)
+		}
+	}
+
+	conflicts := make(map[string][]string)
+	for dir, names := range owners {
+		if len(names) < 2 {
+			continue
+		}
+		overridden := true
+		for _, a := range addons {
+			if !contains(a.OwnDirs, dir) {
+				continue
+			}
+			if !contains(a.Overrides, dir) {
+				overridden = false
+				break
+			}
+		}
+		if !overridden {
+			conflicts[dir] = names
+		}
+	}
+	return conflicts
+}
+
+// ParseTOC extracts dependency directives from a .toc file's contents.
+func ParseTOC(data []byte) Dependencies {
+	var deps Dependencies
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(strings.TrimPrefix(line, "\ufeff"))
+		if !strings.HasPrefix(line, "##") {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(line, "##"), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch strings.TrimSpace(parts[0]) {
+		case "Dependencies", "RequiredDeps":
+			deps.Required = append(deps.Required, splitNames(parts[1])...)
+		case "OptionalDeps":
+			deps.Optional = append(deps.Optional, splitNames(parts[1])...)
+		}
+	}
+	return deps
+}
+
+// MissingRequired returns, for each addon that declares one, the required
+// dependency names not present (by addon name or own directory) among
+// addons.
+func MissingRequired(addons []Addon) map[string][]string {
+	present := make(map[string]bool)
+	for _, a := range addons {
+		present[a.Name] = true
+		for _, d := range a.OwnDirs {
+			present[d] = true
+		}
+	}
+
+	missing := make(map[string][]string)
+	for _, a := range addons {
+		for _, toc := range a.TOC {
+			for _, req := range ParseTOC(toc).Required {
+				if !present[req] {
+					missing[a.Name] = append(missing[a.Name], req)
+				}
+			}
+		}
+	}
+	return missing
+}
+
+func splitNames(s string) []string {
+	var names []string
+	for _, n := range strings.Split(s, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+func contains(s []string, v string) bool {
+	for _, x := range s {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
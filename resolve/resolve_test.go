@@ -0,0 +1,109 @@
+package resolve
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParseTOC(t *testing.T) {
+	toc := "\ufeff## Title: Foo\n" +
+		"## Dependencies: Bar, Baz\n" +
+		"## RequiredDeps: Qux\n" +
+		"## OptionalDeps: Quux, Corge\n" +
+		"not a directive\n"
+
+	got := ParseTOC([]byte(toc))
+
+	wantRequired := []string{"Bar", "Baz", "Qux"}
+	if !reflect.DeepEqual(got.Required, wantRequired) {
+		t.Errorf("Required = %v, want %v", got.Required, wantRequired)
+	}
+	wantOptional := []string{"Quux", "Corge"}
+	if !reflect.DeepEqual(got.Optional, wantOptional) {
+		t.Errorf("Optional = %v, want %v", got.Optional, wantOptional)
+	}
+}
+
+func TestParseTOCEmpty(t *testing.T) {
+	got := ParseTOC([]byte("## Title: Foo\njust some notes\n"))
+	if len(got.Required) != 0 || len(got.Optional) != 0 {
+		t.Errorf("expected no dependencies, got %+v", got)
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	addons := []Addon{
+		{Name: "Foo", OwnDirs: []string{"Shared", "Foo"}},
+		{Name: "Bar", OwnDirs: []string{"Shared", "Bar"}},
+	}
+	conflicts := Conflicts(addons)
+	want := map[string][]string{"Shared": {"Foo", "Bar"}}
+	if !reflect.DeepEqual(normalizeConflicts(conflicts), normalizeConflicts(want)) {
+		t.Errorf("Conflicts() = %v, want %v", conflicts, want)
+	}
+}
+
+func TestConflictsNoOverlap(t *testing.T) {
+	addons := []Addon{
+		{Name: "Foo", OwnDirs: []string{"Foo"}},
+		{Name: "Bar", OwnDirs: []string{"Bar"}},
+	}
+	if conflicts := Conflicts(addons); len(conflicts) != 0 {
+		t.Errorf("Conflicts() = %v, want none", conflicts)
+	}
+}
+
+func TestConflictsOverridden(t *testing.T) {
+	addons := []Addon{
+		{Name: "Foo", OwnDirs: []string{"Shared"}, Overrides: []string{"Shared"}},
+		{Name: "Bar", OwnDirs: []string{"Shared"}, Overrides: []string{"Shared"}},
+	}
+	if conflicts := Conflicts(addons); len(conflicts) != 0 {
+		t.Errorf("Conflicts() = %v, want none (both declared Overrides)", conflicts)
+	}
+}
+
+func TestConflictsPartiallyOverridden(t *testing.T) {
+	// Only one of the two writers declares Overrides, so it's still a conflict.
+	addons := []Addon{
+		{Name: "Foo", OwnDirs: []string{"Shared"}, Overrides: []string{"Shared"}},
+		{Name: "Bar", OwnDirs: []string{"Shared"}},
+	}
+	conflicts := Conflicts(addons)
+	if len(conflicts) != 1 {
+		t.Errorf("Conflicts() = %v, want one conflict on Shared", conflicts)
+	}
+}
+
+func TestMissingRequired(t *testing.T) {
+	addons := []Addon{
+		{Name: "Foo", TOC: map[string][]byte{"Foo.toc": []byte("## RequiredDeps: Bar, Baz")}},
+		{Name: "Bar", OwnDirs: []string{"Bar"}},
+	}
+	missing := MissingRequired(addons)
+	want := map[string][]string{"Foo": {"Baz"}}
+	if !reflect.DeepEqual(missing, want) {
+		t.Errorf("MissingRequired() = %v, want %v", missing, want)
+	}
+}
+
+func TestMissingRequiredSatisfiedByOwnDir(t *testing.T) {
+	addons := []Addon{
+		{Name: "Foo", TOC: map[string][]byte{"Foo.toc": []byte("## RequiredDeps: BarLib")}},
+		{Name: "Bar", OwnDirs: []string{"BarLib"}},
+	}
+	if missing := MissingRequired(addons); len(missing) != 0 {
+		t.Errorf("MissingRequired() = %v, want none", missing)
+	}
+}
+
+func normalizeConflicts(m map[string][]string) map[string][]string {
+	out := make(map[string][]string, len(m))
+	for k, v := range m {
+		names := append([]string(nil), v...)
+		sort.Strings(names)
+		out[k] = names
+	}
+	return out
+}
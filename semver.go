@@ -0,0 +1,140 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// WoW addons don't follow strict SemVer, so comparison and constraint
+// matching for Specification.Version are implemented locally: dot-separated
+// numeric components compare numerically, and a "-tagN" suffix ranks
+// alpha < beta < rc < a plain release.
+
+// compareVersions returns -1, 0, or 1 as a is less than, equal to, or
+// greater than b.
+func compareVersions(a, b string) int {
+	aNums, aTag, aTagN := splitVersion(a)
+	bNums, bTag, bTagN := splitVersion(b)
+
+	if c := compareNums(aNums, bNums); c != 0 {
+		return c
+	}
+
+	if ar, br := prereleaseRank(aTag), prereleaseRank(bTag); ar != br {
+		if ar < br {
+			return -1
+		}
+		return 1
+	}
+	if aTagN != bTagN {
+		if aTagN < bTagN {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// compareNums compares two dot-separated numeric version components,
+// treating a missing trailing component as 0 (so [1] == [1,0]).
+func compareNums(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var an, bn int
+		if i < len(a) {
+			an = a[i]
+		}
+		if i < len(b) {
+			bn = b[i]
+		}
+		if an != bn {
+			if an < bn {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func splitVersion(v string) (nums []int, tag string, tagN int) {
+	v = strings.TrimPrefix(v, "v")
+	main := v
+	if i := strings.IndexByte(v, '-'); i >= 0 {
+		main = v[:i]
+		tag, tagN = splitPrereleaseTag(v[i+1:])
+	}
+	for _, part := range strings.Split(main, ".") {
+		n, _ := strconv.Atoi(part)
+		nums = append(nums, n)
+	}
+	return nums, tag, tagN
+}
+
+func splitPrereleaseTag(s string) (tag string, n int) {
+	i := 0
+	for i < len(s) && (s[i] < '0' || s[i] > '9') {
+		i++
+	}
+	tag = strings.ToLower(s[:i])
+	if i < len(s) {
+		n, _ = strconv.Atoi(s[i:])
+	}
+	return tag, n
+}
+
+func prereleaseRank(tag string) int {
+	switch tag {
+	case "alpha":
+		return 0
+	case "beta":
+		return 1
+	case "rc":
+		return 2
+	default:
+		return 3 // no tag: a plain release
+	}
+}
+
+// satisfiesConstraint checks version against a constraint of the form
+// "==1.2.3", ">=1.2", or "~1.2" (compatible: requires at least the given
+// version and pins the major and minor components to the given values, or
+// just the major for a bare "~1" — "~1.2" means ">=1.2.0 <1.3.0", "~1.2.3"
+// means ">=1.2.3 <1.3.0", "~1" means ">=1.0.0 <2.0.0"). An empty constraint
+// always matches.
+func satisfiesConstraint(version, constraint string) bool {
+	if constraint == "" {
+		return true
+	}
+	op, want := "==", constraint
+	for _, candidate := range []string{"==", ">=", "~"} {
+		if strings.HasPrefix(constraint, candidate) {
+			op = candidate
+			want = strings.TrimPrefix(constraint, candidate)
+			break
+		}
+	}
+
+	switch op {
+	case "==":
+		return compareVersions(version, want) == 0
+	case ">=":
+		return compareVersions(version, want) >= 0
+	case "~":
+		vNums, _, _ := splitVersion(version)
+		wNums, _, _ := splitVersion(want)
+		if compareNums(vNums, wNums) < 0 {
+			return false
+		}
+		// Bump the minor component for the upper bound (or the major, for a
+		// bare "~1"), so "~1.2" and "~1.2.3" both mean "1.2.x" rather than
+		// "1.2 or anything later in the 1.x line".
+		bump := 1
+		if len(wNums) < 2 {
+			bump = 0
+		}
+		upper := append([]int(nil), wNums[:bump+1]...)
+		upper[bump]++
+		return compareNums(vNums, upper) < 0
+	}
+	return false
+}
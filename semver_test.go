@@ -0,0 +1,64 @@
+package main
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.2.3", "1.2.4", -1},
+		{"1.10.0", "1.9.0", 1},
+		{"1.2", "1.2.0", 0},
+		{"1.2.3-alpha1", "1.2.3", -1},
+		{"1.2.3-alpha1", "1.2.3-beta1", -1},
+		{"1.2.3-beta2", "1.2.3-beta1", 1},
+		{"1.2.3-rc1", "1.2.3-beta9", 1},
+		{"v1.2.3", "1.2.3", 0},
+	}
+	for _, c := range cases {
+		if got := compareVersions(c.a, c.b); got != c.want {
+			t.Errorf("compareVersions(%q, %q) = %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestSatisfiesConstraint(t *testing.T) {
+	cases := []struct {
+		version, constraint string
+		want                bool
+	}{
+		{"1.2.3", "", true},
+		{"1.2.3", "==1.2.3", true},
+		{"1.2.4", "==1.2.3", false},
+		{"1.2.0", "==1.2", true}, // missing trailing component treated as 0
+		{"1.2.3", "==1.2", false},
+		{"1.2.0", ">=1.2", true},
+		{"1.1.9", ">=1.2", false},
+		{"2.0.0", ">=1.2", true},
+
+		// "~1.2" means ">=1.2.0 <1.3.0" — must pin the minor, not just the major.
+		{"1.2.0", "~1.2", true},
+		{"1.2.9", "~1.2", true},
+		{"1.1.9", "~1.2", false},
+		{"1.3.0", "~1.2", false},
+		{"1.99.0", "~1.2", false},
+
+		// "~1.2.3" means ">=1.2.3 <1.3.0".
+		{"1.2.3", "~1.2.3", true},
+		{"1.2.9", "~1.2.3", true},
+		{"1.2.2", "~1.2.3", false},
+		{"1.3.0", "~1.2.3", false},
+
+		// "~1" means ">=1.0.0 <2.0.0".
+		{"1.0.0", "~1", true},
+		{"1.9.9", "~1", true},
+		{"2.0.0", "~1", false},
+	}
+	for _, c := range cases {
+		if got := satisfiesConstraint(c.version, c.constraint); got != c.want {
+			t.Errorf("satisfiesConstraint(%q, %q) = %v, want %v", c.version, c.constraint, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/DianeLooney/wpm/cache"
+)
+
+// Release is the normalized result of resolving a Specification against a
+// Source: enough information to fetch and record the artifact without the
+// rest of the program needing to know which backend produced it.
+type Release struct {
+	Name        string
+	Type        string
+	Version     string
+	PublishedAt time.Time
+	URL         string
+	Checksum    string
+	Signature   string // URL of a detached armored signature for URL, if verification was requested
+	PublicKey   string // fingerprint the signature must be signed by, if pinned
+}
+
+// Source knows how to resolve a Specification to a concrete Release and fetch
+// that Release's contents as a zip. Backends register themselves into
+// sources under the Type string they handle.
+type Source interface {
+	Resolve(spec *Specification) (Release, error)
+	Fetch(release Release) (*zip.Reader, error)
+}
+
+var sources = make(map[string]Source)
+
+func registerSource(typ string, src Source) {
+	sources[typ] = src
+}
+
+// dlCache is the shared download cache used by every network-backed
+// Source. It's nil until main() opens it, so backends fall back to a
+// direct download (e.g. under test).
+var dlCache *cache.Index
+
+// offline, when set by the upgrade command's --offline flag, forbids any
+// cache miss from reaching the network.
+var offline bool
+
+// fetchCached routes a backend's download through dlCache, so repeated
+// upgrades of an unchanged addon don't re-hit CurseForge/WoWAce/etc.
+func fetchCached(name, typ, version, url string, download func() ([]byte, error)) ([]byte, error) {
+	if dlCache == nil {
+		if offline {
+			return nil, fmt.Errorf("no cache available for offline fetch of %v", url)
+		}
+		return download()
+	}
+	if offline {
+		return dlCache.Offline(url)
+	}
+	return dlCache.Fetch(name, typ, version, url, download)
+}
+
+// requireSignatures is set by upgrade's --require-signatures flag; when
+// true, a release with no signature to verify is rejected instead of just
+// warned about.
+var requireSignatures bool
+
+// fetchCachedVerified wraps fetchCached with optional PGP verification: if
+// release.Signature is set, the detached signature is fetched (through the
+// same cache) and checked against the downloaded bytes before they're
+// handed back. A release with no signature is let through with a warning
+// for curse/wowace (which never publish one), unless --require-signatures
+// was passed.
+func fetchCachedVerified(release Release, download func() ([]byte, error)) ([]byte, error) {
+	b, err := fetchCached(release.Name, release.Type, release.Version, release.URL, download)
+	if err != nil {
+		return nil, err
+	}
+	if release.Signature == "" {
+		if requireSignatures {
+			return nil, fmt.Errorf("%v: no signature available and --require-signatures is set", release.Name)
+		}
+		if release.Type == "curse" || release.Type == "wowace" {
+			fmt.Printf("Warning: %v (%v) ships no signature to verify\n", release.Name, release.Type)
+		}
+		return b, nil
+	}
+
+	sig, err := fetchCached(release.Name, release.Type, release.Version, release.Signature, func() ([]byte, error) {
+		resp, err := http.Get(release.Signature)
+		if err != nil {
+			return nil, fmt.Errorf("error getting signature: %v", err)
+		}
+		defer resp.Body.Close()
+		return ioutil.ReadAll(resp.Body)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%v: unable to fetch signature: %v", release.Name, err)
+	}
+	if err := verifySignature(b, sig, release.PublicKey); err != nil {
+		return nil, fmt.Errorf("%v: signature verification failed: %v", release.Name, err)
+	}
+	return b, nil
+}
+
+// ownDirsFromZip returns the set of top-level path segments a zip's entries
+// live under, e.g. {"Foo", "FooOptions"} for a zip containing Foo/Foo.lua
+// and FooOptions/Options.lua. A loose root-level entry (e.g. a README next
+// to the addon folder) is its own top-level segment rather than being
+// walked up past the root. Used so an installed addon can be identified
+// (and removed) by directory alone, without re-reading its zip.
+func ownDirsFromZip(zr *zip.Reader) []string {
+	dirs := make(map[string]struct{})
+	yes := struct{}{}
+	for _, f := range zr.File {
+		if f.Name == "." || f.Name == "" {
+			continue
+		}
+		top := f.Name
+		if i := strings.IndexByte(top, '/'); i >= 0 {
+			top = top[:i]
+		}
+		dirs[top] = yes
+	}
+	ownDirs := make([]string, 0, len(dirs))
+	for d := range dirs {
+		ownDirs = append(ownDirs, d)
+	}
+	return ownDirs
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// curseForgeSource implements Source for the two CurseForge-hosted listing
+// sites wpm has always supported: CurseForge itself and WoWAce. They share
+// the same HTML listing/download-button layout and only differ by domain.
+type curseForgeSource struct {
+	typ        string
+	listURLFmt string
+	baseURL    string
+}
+
+func init() {
+	registerSource("curse", &curseForgeSource{
+		typ:        "curse",
+		listURLFmt: "https://wow.curseforge.com/projects/%v/files",
+		baseURL:    "https://wow.curseforge.com",
+	})
+	registerSource("wowace", &curseForgeSource{
+		typ:        "wowace",
+		listURLFmt: "https://www.wowace.com/projects/%v/files",
+		baseURL:    "https://www.wowace.com",
+	})
+}
+
+// channelRank orders release channels from most to least stable so a spec
+// requesting "beta" also accepts "release" files, and "alpha" accepts
+// anything.
+var channelRank = map[string]int{"release": 0, "beta": 1, "alpha": 2}
+
+func channelSatisfies(want, have string) bool {
+	if want == "" {
+		want = "release"
+	}
+	if have == "" {
+		have = "release"
+	}
+	return channelRank[have] <= channelRank[want]
+}
+
+func (s *curseForgeSource) Resolve(spec *Specification) (Release, error) {
+	u := fmt.Sprintf(s.listURLFmt, spec.Name)
+	resp, err := http.Get(u)
+	if err != nil {
+		return Release{}, fmt.Errorf("unable to get the index for %v: %v", spec.Name, err)
+	}
+	defer resp.Body.Close()
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return Release{}, fmt.Errorf("unable to parse the returned document into goquery: %v", err)
+	}
+
+	var best struct {
+		href    string
+		version string
+	}
+	doc.Find("table.project-file-listing tr.project-file-list-item").Each(func(i int, sel *goquery.Selection) {
+		version := strings.TrimSpace(sel.Find("div.project-file-name-container .overflow-tip").Text())
+		phase, _ := sel.Find("td.project-file-release-type>div").Attr("class")
+		channel := "release"
+		switch {
+		case strings.Contains(phase, "release-phase-alpha"):
+			channel = "alpha"
+		case strings.Contains(phase, "release-phase-beta"):
+			channel = "beta"
+		}
+		if !channelSatisfies(spec.Channel, channel) {
+			return
+		}
+		if !satisfiesConstraint(version, spec.Version) {
+			return
+		}
+		if best.href != "" && compareVersions(version, best.version) <= 0 {
+			return
+		}
+		href, _ := sel.Find("div.project-file-download-button a.button.tip.fa-icon-download").Attr("href")
+		if href == "" {
+			return
+		}
+		best.href = href
+		best.version = version
+	})
+	if best.href == "" {
+		return Release{}, fmt.Errorf("no files found for %v matching channel %q version %q", spec.Name, spec.Channel, spec.Version)
+	}
+
+	url := s.baseURL + best.href
+	sig, pub := signatureFor(spec, url)
+	return Release{Name: spec.Name, Type: s.typ, Version: best.version, URL: url, Signature: sig, PublicKey: pub}, nil
+}
+
+func (s *curseForgeSource) Fetch(release Release) (*zip.Reader, error) {
+	b, err := fetchCachedVerified(release, func() ([]byte, error) {
+		resp, err := http.Get(release.URL)
+		if err != nil {
+			return nil, fmt.Errorf("error getting zip: %v", err)
+		}
+		defer resp.Body.Close()
+		return ioutil.ReadAll(resp.Body)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return zip.NewReader(bytes.NewReader(b), int64(len(b)))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// githubSource resolves addons published as GitHub Releases. Specification.
+// Location holds "owner/repo", Branch (if set) must equal a release's tag
+// name exactly, which is the only way a prerelease is picked (without
+// Branch, prereleases are skipped), Version (if set) constrains candidates by
+// satisfiesConstraint against the tag name, and Pattern is a regex matched
+// against asset names to pick which release asset to download.
+type githubSource struct{}
+
+func init() { registerSource("github", githubSource{}) }
+
+type githubRelease struct {
+	TagName     string `json:"tag_name"`
+	Prerelease  bool   `json:"prerelease"`
+	PublishedAt string `json:"published_at"`
+	Assets      []struct {
+		Name               string `json:"name"`
+		BrowserDownloadURL string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+func (githubSource) Resolve(spec *Specification) (Release, error) {
+	u := fmt.Sprintf("https://api.github.com/repos/%v/releases", spec.Location)
+	resp, err := http.Get(u)
+	if err != nil {
+		return Release{}, fmt.Errorf("unable to get releases for %v: %v", spec.Location, err)
+	}
+	defer resp.Body.Close()
+
+	var releases []githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return Release{}, fmt.Errorf("unable to parse releases for %v: %v", spec.Location, err)
+	}
+
+	assetPattern := regexp.MustCompile(".*")
+	if spec.Pattern != "" {
+		assetPattern, err = regexp.Compile(spec.Pattern)
+		if err != nil {
+			return Release{}, fmt.Errorf("invalid asset pattern %q: %v", spec.Pattern, err)
+		}
+	}
+
+	for _, rel := range releases {
+		if spec.Branch != "" && rel.TagName != spec.Branch {
+			continue
+		}
+		if spec.Branch == "" && rel.Prerelease {
+			continue
+		}
+		if !satisfiesConstraint(rel.TagName, spec.Version) {
+			continue
+		}
+		for _, a := range rel.Assets {
+			if !assetPattern.MatchString(a.Name) {
+				continue
+			}
+			publishedAt, _ := time.Parse(time.RFC3339, rel.PublishedAt)
+			sig, pub := signatureFor(spec, a.BrowserDownloadURL)
+			return Release{
+				Name:        spec.Name,
+				Type:        "github",
+				Version:     rel.TagName,
+				PublishedAt: publishedAt,
+				URL:         a.BrowserDownloadURL,
+				Signature:   sig,
+				PublicKey:   pub,
+			}, nil
+		}
+	}
+	return Release{}, fmt.Errorf("no matching release asset found for %v matching version %q", spec.Location, spec.Version)
+}
+
+func (githubSource) Fetch(release Release) (*zip.Reader, error) {
+	b, err := fetchCachedVerified(release, func() ([]byte, error) {
+		resp, err := http.Get(release.URL)
+		if err != nil {
+			return nil, fmt.Errorf("error getting asset: %v", err)
+		}
+		defer resp.Body.Close()
+		return ioutil.ReadAll(resp.Body)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return zip.NewReader(bytes.NewReader(b), int64(len(b)))
+}
@@ -0,0 +1,31 @@
+package main
+
+import "archive/zip"
+
+// ignoreSource handles addons wpm shouldn't touch at all: it owns the
+// directory named after the spec but never fetches or writes anything.
+type ignoreSource struct{}
+
+func init() { registerSource("ignore", ignoreSource{}) }
+
+func (ignoreSource) Resolve(spec *Specification) (Release, error) {
+	return Release{}, nil
+}
+
+func (ignoreSource) Fetch(release Release) (*zip.Reader, error) {
+	return nil, nil
+}
+
+// linkSource handles addons that are hard-linked in from elsewhere on disk
+// (e.g. a local dev checkout) rather than downloaded.
+type linkSource struct{}
+
+func init() { registerSource("link", linkSource{}) }
+
+func (linkSource) Resolve(spec *Specification) (Release, error) {
+	return Release{}, nil
+}
+
+func (linkSource) Fetch(release Release) (*zip.Reader, error) {
+	return nil, nil
+}
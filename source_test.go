@@ -0,0 +1,70 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestOwnDirsFromZipRootLevelEntry(t *testing.T) {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, name := range []string{"README.md", "Foo/Foo.lua", "Foo/Foo.toc"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("zw.Create: %v", err)
+		}
+		if _, err := w.Write([]byte("x")); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zw.Close: %v", err)
+	}
+	b := buf.Bytes()
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("zip.NewReader: %v", err)
+	}
+
+	got := ownDirsFromZip(zr)
+	sort.Strings(got)
+	want := []string{"Foo", "README.md"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ownDirsFromZip() = %v, want %v", got, want)
+	}
+}
+
+// withRequireSignatures sets requireSignatures for the duration of the test
+// and restores it afterward, since it's a package-level flag normally set
+// once by upgrade's --require-signatures.
+func withRequireSignatures(t *testing.T, v bool) {
+	t.Helper()
+	old := requireSignatures
+	requireSignatures = v
+	t.Cleanup(func() { requireSignatures = old })
+}
+
+func TestFetchCachedVerifiedNoSignature(t *testing.T) {
+	withRequireSignatures(t, false)
+	release := Release{Name: "Foo", Type: "curse"}
+	want := []byte("addon contents")
+	got, err := fetchCachedVerified(release, func() ([]byte, error) { return want, nil })
+	if err != nil {
+		t.Fatalf("fetchCachedVerified: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("fetchCachedVerified = %q, want %q", got, want)
+	}
+}
+
+func TestFetchCachedVerifiedRequireSignatures(t *testing.T) {
+	withRequireSignatures(t, true)
+	release := Release{Name: "Foo", Type: "curse"}
+	_, err := fetchCachedVerified(release, func() ([]byte, error) { return []byte("x"), nil })
+	if err == nil {
+		t.Fatal("expected fetchCachedVerified to reject an unsigned release with --require-signatures set")
+	}
+}
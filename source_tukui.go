@@ -0,0 +1,72 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// tukuiSource resolves addons published through Tukui's JSON API. Specific
+// main addons (Tukui, ElvUI) are keyed by "ui", everything else by numeric
+// addon id, so Specification.Name is passed through untouched and
+// Specification.Location, if set, overrides the query parameter name.
+type tukuiSource struct{}
+
+func init() { registerSource("tukui", tukuiSource{}) }
+
+type tukuiAddon struct {
+	Version    string `json:"version"`
+	URL        string `json:"url"`
+	LastUpdate string `json:"lastupdate"`
+	MD5        string `json:"md5"`
+}
+
+func (tukuiSource) Resolve(spec *Specification) (Release, error) {
+	param := "addon"
+	if spec.Location != "" {
+		param = spec.Location
+	}
+	u := fmt.Sprintf("https://www.tukui.org/api.php?%v=%v", param, spec.Name)
+	resp, err := http.Get(u)
+	if err != nil {
+		return Release{}, fmt.Errorf("unable to query tukui for %v: %v", spec.Name, err)
+	}
+	defer resp.Body.Close()
+
+	var addon tukuiAddon
+	if err := json.NewDecoder(resp.Body).Decode(&addon); err != nil {
+		return Release{}, fmt.Errorf("unable to parse tukui response for %v: %v", spec.Name, err)
+	}
+	if addon.URL == "" {
+		return Release{}, fmt.Errorf("tukui has no download for %v", spec.Name)
+	}
+
+	sig, pub := signatureFor(spec, addon.URL)
+	return Release{
+		Name:      spec.Name,
+		Type:      "tukui",
+		Version:   addon.Version,
+		URL:       addon.URL,
+		Checksum:  addon.MD5,
+		Signature: sig,
+		PublicKey: pub,
+	}, nil
+}
+
+func (tukuiSource) Fetch(release Release) (*zip.Reader, error) {
+	b, err := fetchCachedVerified(release, func() ([]byte, error) {
+		resp, err := http.Get(release.URL)
+		if err != nil {
+			return nil, fmt.Errorf("error getting zip: %v", err)
+		}
+		defer resp.Body.Close()
+		return ioutil.ReadAll(resp.Body)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return zip.NewReader(bytes.NewReader(b), int64(len(b)))
+}
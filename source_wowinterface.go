@@ -0,0 +1,65 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// wowInterfaceSource resolves addons from WoWInterface's downloads API.
+// Specification.Name holds the numeric addon id.
+type wowInterfaceSource struct{}
+
+func init() { registerSource("wowinterface", wowInterfaceSource{}) }
+
+type wowInterfaceAddon struct {
+	UIDownload string `json:"UIDownload"`
+	UIVersion  string `json:"UIVersion"`
+	UIMD5      string `json:"UIMD5"`
+}
+
+func (wowInterfaceSource) Resolve(spec *Specification) (Release, error) {
+	u := fmt.Sprintf("https://api.wowinterface.com/addons/info/%v.json", spec.Name)
+	resp, err := http.Get(u)
+	if err != nil {
+		return Release{}, fmt.Errorf("unable to query wowinterface for %v: %v", spec.Name, err)
+	}
+	defer resp.Body.Close()
+
+	var addons []wowInterfaceAddon
+	if err := json.NewDecoder(resp.Body).Decode(&addons); err != nil {
+		return Release{}, fmt.Errorf("unable to parse wowinterface response for %v: %v", spec.Name, err)
+	}
+	if len(addons) == 0 || addons[0].UIDownload == "" {
+		return Release{}, fmt.Errorf("wowinterface has no download for %v", spec.Name)
+	}
+
+	sig, pub := signatureFor(spec, addons[0].UIDownload)
+	return Release{
+		Name:      spec.Name,
+		Type:      "wowinterface",
+		Version:   addons[0].UIVersion,
+		URL:       addons[0].UIDownload,
+		Checksum:  addons[0].UIMD5,
+		Signature: sig,
+		PublicKey: pub,
+	}, nil
+}
+
+func (wowInterfaceSource) Fetch(release Release) (*zip.Reader, error) {
+	b, err := fetchCachedVerified(release, func() ([]byte, error) {
+		resp, err := http.Get(release.URL)
+		if err != nil {
+			return nil, fmt.Errorf("error getting zip: %v", err)
+		}
+		defer resp.Body.Close()
+		return ioutil.ReadAll(resp.Body)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return zip.NewReader(bytes.NewReader(b), int64(len(b)))
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// linkPlan is the staged state for a "link"-type addon: there's nothing to
+// write ahead of time, just a hard link to (re)create at Commit.
+type linkPlan struct {
+	src string
+	dir string // own dir, relative to base
+}
+
+// AddonTransaction stages one addon's install/update into a scratch
+// directory under the installation root and only swaps it into place once
+// every file has staged successfully, so a failure partway through an
+// upgrade can never leave an addon half-installed. Prepare does all the
+// work that can fail without touching the live tree; Commit does nothing
+// but renames (or, for a link addon, creates the hard link); Rollback undoes
+// whatever Commit managed to do.
+type AddonTransaction struct {
+	name string
+	base string
+
+	dirs  []string             // own directories, relative to base, swapped wholesale
+	files map[string]*zip.File // relative path -> zip entry, for the zip-backed case
+	link  *linkPlan            // set instead of dirs/files for "link"-type addons
+
+	stagingDir string
+	backupDir  string
+	touched    []touchedDir // every dir Commit wrote to, in write order, for Rollback
+}
+
+// touchedDir records one directory Commit wrote to so Rollback can undo it:
+// restore it from backupDir if it replaced something that existed, or
+// remove it outright if Commit created it fresh.
+type touchedDir struct {
+	dir   string
+	isNew bool
+}
+
+func newAddonTransaction(name, base string) *AddonTransaction {
+	id := fmt.Sprintf("%v-%x", name, time.Now().UnixNano())
+	return &AddonTransaction{
+		name:       name,
+		base:       base,
+		files:      make(map[string]*zip.File),
+		stagingDir: path.Join(base, ".wpm-tx-"+id),
+		backupDir:  path.Join(base, ".wpm-tx-"+id+"-backup"),
+	}
+}
+
+// Prepare stages every write into the scratch directory, touching nothing
+// in the live installation.
+func (tx *AddonTransaction) Prepare() error {
+	if tx.link != nil || len(tx.files) == 0 {
+		return nil
+	}
+	for rel, zf := range tx.files {
+		clean := path.Clean(rel)
+		if clean == ".." || strings.HasPrefix(clean, "../") || path.IsAbs(clean) {
+			return fmt.Errorf("%v: zip entry %q escapes the staging directory", tx.name, rel)
+		}
+		dst := path.Join(tx.stagingDir, clean)
+		if err := os.MkdirAll(path.Dir(dst), 0755); err != nil {
+			return fmt.Errorf("%v: unable to stage %v: %v", tx.name, rel, err)
+		}
+		rd, err := zf.Open()
+		if err != nil {
+			return fmt.Errorf("%v: unable to open %v: %v", tx.name, rel, err)
+		}
+		data, err := ioutil.ReadAll(rd)
+		rd.Close()
+		if err != nil {
+			return fmt.Errorf("%v: unable to read %v: %v", tx.name, rel, err)
+		}
+		if err := ioutil.WriteFile(dst, data, 0644); err != nil {
+			return fmt.Errorf("%v: unable to stage %v: %v", tx.name, rel, err)
+		}
+	}
+	return nil
+}
+
+// validateDir rejects an own-dir that would escape the installation root
+// once joined against tx.base, the same check Prepare already applies to
+// zip entry paths. tx.dirs and link.dir come straight from zip contents
+// (ownDirsFromZip, source.go) or addon names, so a crafted zip whose
+// top-level entry is ".." or an absolute path must be caught here rather
+// than trusted to resolve somewhere harmless.
+func (tx *AddonTransaction) validateDir(dir string) error {
+	clean := path.Clean(dir)
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") || path.IsAbs(clean) {
+		return fmt.Errorf("%v: own dir %q escapes the installation directory", tx.name, dir)
+	}
+	return nil
+}
+
+// Commit backs up any existing target directory, then rename-swaps the
+// staged tree (or creates the hard link) into its place.
+func (tx *AddonTransaction) Commit() error {
+	if err := os.MkdirAll(tx.backupDir, 0755); err != nil {
+		return fmt.Errorf("%v: unable to create backup dir: %v", tx.name, err)
+	}
+
+	if tx.link != nil {
+		if err := tx.validateDir(tx.link.dir); err != nil {
+			return err
+		}
+		target := path.Join(tx.base, tx.link.dir)
+		if err := tx.backup(target, tx.link.dir); err != nil {
+			return err
+		}
+		if err := os.Link(tx.link.src, target); err != nil {
+			return fmt.Errorf("%v: unable to link %v: %v", tx.name, target, err)
+		}
+		return nil
+	}
+
+	for _, dir := range tx.dirs {
+		if err := tx.validateDir(dir); err != nil {
+			return err
+		}
+		target := path.Join(tx.base, dir)
+		staged := path.Join(tx.stagingDir, dir)
+		if err := tx.backup(target, dir); err != nil {
+			return err
+		}
+		if _, err := os.Stat(staged); err != nil {
+			continue // addon owns this dir but the zip had nothing under it
+		}
+		if err := os.MkdirAll(path.Dir(target), 0755); err != nil {
+			return fmt.Errorf("%v: unable to prepare %v: %v", tx.name, target, err)
+		}
+		if err := os.Rename(staged, target); err != nil {
+			return fmt.Errorf("%v: unable to install %v: %v", tx.name, target, err)
+		}
+	}
+	return nil
+}
+
+// backup moves an existing target directory out of the way into
+// tx.backupDir, or, if there's nothing there yet, just records that Commit
+// is about to create target from scratch. Either way the dir is recorded so
+// Rollback can undo it: restore it from the backup, or remove it outright.
+func (tx *AddonTransaction) backup(target, dir string) error {
+	if _, err := os.Stat(target); os.IsNotExist(err) {
+		tx.touched = append(tx.touched, touchedDir{dir: dir, isNew: true})
+		return nil
+	}
+	backup := path.Join(tx.backupDir, dir)
+	if err := os.MkdirAll(path.Dir(backup), 0755); err != nil {
+		return fmt.Errorf("%v: unable to prepare backup for %v: %v", tx.name, target, err)
+	}
+	if err := os.Rename(target, backup); err != nil {
+		return fmt.Errorf("%v: unable to back up %v: %v", tx.name, target, err)
+	}
+	tx.touched = append(tx.touched, touchedDir{dir: dir})
+	return nil
+}
+
+// Rollback undoes every directory Commit touched, in reverse order, and
+// removes the scratch trees: a dir that replaced an existing one is
+// restored from its backup, a dir Commit created fresh is removed outright.
+// Without the isNew case a fresh install that fails partway through Commit
+// (or gets rolled back after the fact, as main's upgrade does for every
+// already-committed addon when a later one fails) would leave its new
+// directories installed with nothing recorded to undo them.
+func (tx *AddonTransaction) Rollback() error {
+	for i := len(tx.touched) - 1; i >= 0; i-- {
+		t := tx.touched[i]
+		target := path.Join(tx.base, t.dir)
+		if t.isNew {
+			if err := os.RemoveAll(target); err != nil {
+				return fmt.Errorf("%v: unable to remove %v: %v", tx.name, target, err)
+			}
+			continue
+		}
+		backup := path.Join(tx.backupDir, t.dir)
+		os.RemoveAll(target)
+		if err := os.Rename(backup, target); err != nil {
+			return fmt.Errorf("%v: unable to restore %v from backup: %v", tx.name, target, err)
+		}
+	}
+	tx.touched = nil
+	os.RemoveAll(tx.stagingDir)
+	os.RemoveAll(tx.backupDir)
+	return nil
+}
+
+// Cleanup removes the scratch trees left behind by a successful Commit.
+func (tx *AddonTransaction) Cleanup() {
+	os.RemoveAll(tx.stagingDir)
+	os.RemoveAll(tx.backupDir)
+}
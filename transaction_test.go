@@ -0,0 +1,138 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+// zipFile builds a one-entry in-memory zip and returns the *zip.File for it.
+func zipFile(t *testing.T, name, contents string) *zip.File {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	w, err := zw.Create(name)
+	if err != nil {
+		t.Fatalf("zw.Create: %v", err)
+	}
+	if _, err := w.Write([]byte(contents)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zw.Close: %v", err)
+	}
+	b := buf.Bytes()
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("zip.NewReader: %v", err)
+	}
+	return zr.File[0]
+}
+
+// TestRollbackRemovesFreshInstall covers the case where there's nothing to
+// back up: Commit creates "Foo" from scratch, so Rollback must remove it
+// rather than silently leave it installed.
+func TestRollbackRemovesFreshInstall(t *testing.T) {
+	base := t.TempDir()
+
+	tx := newAddonTransaction("Foo", base)
+	tx.dirs = []string{"Foo"}
+	tx.files["Foo/Foo.lua"] = zipFile(t, "Foo/Foo.lua", "-- fresh")
+
+	if err := tx.Prepare(); err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if _, err := os.Stat(path.Join(base, "Foo")); err != nil {
+		t.Fatalf("Foo should exist after Commit: %v", err)
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if _, err := os.Stat(path.Join(base, "Foo")); !os.IsNotExist(err) {
+		t.Fatalf("Foo should be gone after rolling back a fresh install, got err=%v", err)
+	}
+}
+
+// TestRollbackRestoresExisting covers the upgrade case: Commit replaces an
+// existing "Foo", and Rollback must put the original content back.
+func TestRollbackRestoresExisting(t *testing.T) {
+	base := t.TempDir()
+	if err := os.MkdirAll(path.Join(base, "Foo"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := ioutil.WriteFile(path.Join(base, "Foo", "Foo.lua"), []byte("-- old"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	tx := newAddonTransaction("Foo", base)
+	tx.dirs = []string{"Foo"}
+	tx.files["Foo/Foo.lua"] = zipFile(t, "Foo/Foo.lua", "-- new")
+
+	if err := tx.Prepare(); err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(path.Join(base, "Foo", "Foo.lua"))
+	if err != nil {
+		t.Fatalf("read restored file: %v", err)
+	}
+	if string(data) != "-- old" {
+		t.Fatalf("expected original content restored, got %q", data)
+	}
+}
+
+// TestPrepareRejectsPathTraversal covers a malicious or corrupt zip entry
+// trying to write outside the staging directory.
+func TestPrepareRejectsPathTraversal(t *testing.T) {
+	base := t.TempDir()
+
+	tx := newAddonTransaction("Foo", base)
+	tx.dirs = []string{"Foo"}
+	tx.files["../../etc/passwd"] = zipFile(t, "../../etc/passwd", "pwned")
+
+	if err := tx.Prepare(); err == nil {
+		t.Fatal("expected Prepare to reject a zip entry that escapes the staging directory")
+	}
+}
+
+// TestCommitRejectsPathTraversalDir covers an own dir derived from a
+// malicious zip's top-level entry (e.g. "..") rather than a file path:
+// Commit must reject it instead of joining it against the live installation
+// directory.
+func TestCommitRejectsPathTraversalDir(t *testing.T) {
+	base := t.TempDir()
+
+	tx := newAddonTransaction("Foo", base)
+	tx.dirs = []string{".."}
+
+	if err := tx.Commit(); err == nil {
+		t.Fatal("expected Commit to reject an own dir that escapes the installation directory")
+	}
+}
+
+// TestCommitRejectsPathTraversalLinkDir covers the "link"-type addon case:
+// the own dir for a link comes from the addon name rather than a zip, but
+// the same guard must still apply since names can come from user input.
+func TestCommitRejectsPathTraversalLinkDir(t *testing.T) {
+	base := t.TempDir()
+
+	tx := newAddonTransaction("Foo", base)
+	tx.link = &linkPlan{src: t.TempDir(), dir: "../escaped"}
+
+	if err := tx.Commit(); err == nil {
+		t.Fatal("expected Commit to reject a link dir that escapes the installation directory")
+	}
+}